@@ -8,6 +8,7 @@ import (
 	"github.com/aau-network-security/go-ntp/virtual"
 	"github.com/aau-network-security/go-ntp/virtual/docker"
 	"github.com/aau-network-security/go-ntp/virtual/vbox"
+	"github.com/hashicorp/go-hclog"
 )
 
 var (
@@ -39,10 +40,31 @@ type exercise struct {
 	dnsRecords []RecordConfig
 	dockerHost DockerHost
 	lib        vbox.Library
+	logger     hclog.Logger
+}
+
+// Opt configures an exercise at construction time.
+type Opt func(*exercise)
+
+// WithLogger overrides the logger an exercise derives its sub-logger from;
+// unset, it logs nowhere.
+func WithLogger(l hclog.Logger) Opt {
+	return func(e *exercise) { e.logger = l }
+}
+
+// log returns the exercise's named, tag-scoped sub-logger, falling back to a
+// null logger for exercises constructed without WithLogger.
+func (e *exercise) log() hclog.Logger {
+	if e.logger == nil {
+		e.logger = hclog.NewNullLogger()
+	}
+	return e.logger.Named("exercise").With("tag", e.conf.Tag)
 }
 
 func (e *exercise) Create() error {
+	logger := e.log()
 	containers, records := e.conf.ContainerOpts()
+	logger.Debug("creating containers", "count", len(containers))
 
 	var machines []virtual.Instance
 	var newIps []int
@@ -107,6 +129,8 @@ func (e *exercise) Create() error {
 }
 
 func (e *exercise) Start() error {
+	logger := e.log()
+	logger.Debug("starting machines", "count", len(e.machines))
 	for _, m := range e.machines {
 		if err := m.Start(); err != nil {
 			return err
@@ -116,6 +140,8 @@ func (e *exercise) Start() error {
 }
 
 func (e *exercise) Stop() error {
+	logger := e.log()
+	logger.Debug("stopping machines", "count", len(e.machines))
 	for _, m := range e.machines {
 		if err := m.Stop(); err != nil {
 			return err
@@ -126,6 +152,8 @@ func (e *exercise) Stop() error {
 }
 
 func (e *exercise) Close() error {
+	logger := e.log()
+	logger.Debug("closing machines", "count", len(e.machines))
 	for _, m := range e.machines {
 		if err := m.Close(); err != nil {
 			return err
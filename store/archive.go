@@ -0,0 +1,258 @@
+// Copyright (c) 2018-2019 Aalborg University
+// Use of this source code is governed by a GPLv3
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// solvedChallengesForTeam rebuilds a team's solved-challenge history from the
+// award log rather than the in-memory ChalMap: nothing populates ChalMap on
+// the store-side Team (it only exists for the live, in-process team), so the
+// append-only award log written by CompleteChallenge is the only durable
+// record of what a team actually solved.
+func solvedChallengesForTeam(teamID string, awards AwardList) []Challenge {
+	var solved []Challenge
+	for _, a := range awards {
+		if a.TeamID != teamID {
+			continue
+		}
+
+		completedAt := time.Unix(a.When, 0)
+		solved = append(solved, Challenge{
+			FlagTag:     Tag(a.Tag),
+			Category:    a.Category,
+			Points:      a.Points,
+			CompletedAt: &completedAt,
+		})
+	}
+
+	return solved
+}
+
+// writeAwardsLog writes an awards.log in the same line format AddAward
+// appends, so an archived event carries its scoring history verbatim.
+func writeAwardsLog(awards AwardList, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, a := range awards {
+		if _, err := fmt.Fprintln(f, a.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tarGzDir writes dir as a gzip-compressed tarball to destPath.
+func tarGzDir(dir string, destPath string) error {
+	f, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return tarGzWriter(dir, f)
+}
+
+// tarGzWriter writes dir as a gzip-compressed tarball to w.
+func tarGzWriter(dir string, w io.Writer) error {
+	gzw := gzip.NewWriter(w)
+	defer gzw.Close()
+
+	tw := tar.NewWriter(gzw)
+	defer tw.Close()
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// safeJoin joins name onto dir, rejecting absolute paths and "../" entries
+// that would otherwise let a crafted tarball write outside dir (Zip-Slip).
+func safeJoin(dir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("illegal absolute path in archive: %q", name)
+	}
+
+	target := filepath.Join(dir, name)
+
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal file path in archive: %q", name)
+	}
+
+	return target, nil
+}
+
+// untarGz extracts a gzip-compressed tarball produced by tarGzDir into dir.
+func untarGz(srcPath string, dir string) error {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		out.Close()
+	}
+}
+
+// writeSHA256Manifest writes a "<hex-digest>  <filename>" manifest next to
+// path, named path+".sha256", so the archive's integrity can be verified
+// independently of the application that created it.
+func writeSHA256Manifest(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	manifest := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(path))
+
+	return ioutil.WriteFile(path+".sha256", []byte(manifest), 0644)
+}
+
+// Restore rehydrates an archived event produced by Archive into a read-only
+// EventFile suitable for post-event analysis. The tarball is extracted into
+// a temporary directory that is removed automatically if Restore fails, and
+// otherwise owned by the returned EventFile: callers must call Cleanup once
+// they are done with it, or the extracted copy leaks on disk for the
+// lifetime of the process. RawEventFile-backed mutations are rejected with
+// ReadOnlyErr.
+func (h *eventfilehub) Restore(path string) (EventFile, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	dir, err := ioutil.TempDir("", "haaukins-restore-")
+	if err != nil {
+		return nil, err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	if err := untarGz(path, dir); err != nil {
+		return nil, err
+	}
+
+	confBytes, err := ioutil.ReadFile(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	var conf EventConfig
+	if err := yaml.Unmarshal(confBytes, &conf); err != nil {
+		return nil, err
+	}
+
+	teamsBytes, err := ioutil.ReadFile(filepath.Join(dir, "teams.yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	var teams []Team
+	if err := yaml.Unmarshal(teamsBytes, &teams); err != nil {
+		return nil, err
+	}
+
+	ef, err := NewEventFile(dir, "config.yml", RawEventFile{EventConfig: conf, Teams: teams})
+	if err != nil {
+		return nil, err
+	}
+	ef.readOnly = true
+	ef.tempDir = true
+	ef.archived = true
+	ef.archiveDir = dir
+	ok = true
+
+	return ef, nil
+}
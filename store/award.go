@@ -0,0 +1,209 @@
+// Copyright (c) 2018-2019 Aalborg University
+// Use of this source code is governed by a GPLv3
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Award is a single scoring event, modelled on MOTH's awards log: an
+// append-only record of the points a team earned in a category at a given
+// point in time.
+type Award struct {
+	When     int64  `yaml:"when" json:"when"`
+	TeamID   string `yaml:"team-id" json:"team-id"`
+	Tag      string `yaml:"tag" json:"tag"`
+	Category string `yaml:"category" json:"category"`
+	Points   int    `yaml:"points" json:"points"`
+}
+
+// String formats the award as a single line suitable for appending to
+// awards.log, e.g. "1558364461 3ad21 web-security web-security-1 50".
+// Category is free-form text set by whoever defines the challenge (see
+// Challenge.Category) and may contain whitespace or newlines, so it is
+// query-escaped to keep the line a fixed five-field, whitespace-delimited
+// record; ParseAward reverses the escaping.
+func (a Award) String() string {
+	return fmt.Sprintf("%d %s %s %s %d", a.When, a.TeamID, a.Tag, url.QueryEscape(a.Category), a.Points)
+}
+
+// ParseAward parses a single line produced by Award.String.
+func ParseAward(line string) (Award, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 5 {
+		return Award{}, fmt.Errorf("invalid award line: %q", line)
+	}
+
+	when, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return Award{}, fmt.Errorf("invalid award timestamp %q: %s", fields[0], err)
+	}
+
+	category, err := url.QueryUnescape(fields[3])
+	if err != nil {
+		return Award{}, fmt.Errorf("invalid award category %q: %s", fields[3], err)
+	}
+
+	points, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return Award{}, fmt.Errorf("invalid award points %q: %s", fields[4], err)
+	}
+
+	return Award{
+		When:     when,
+		TeamID:   fields[1],
+		Tag:      fields[2],
+		Category: category,
+		Points:   points,
+	}, nil
+}
+
+// AwardList is a chronologically sortable list of awards.
+type AwardList []Award
+
+func (al AwardList) Len() int           { return len(al) }
+func (al AwardList) Less(i, j int) bool { return al[i].When < al[j].When }
+func (al AwardList) Swap(i, j int)      { al[i], al[j] = al[j], al[i] }
+
+// AwardStore persists and serves the append-only scoring log for an event.
+type AwardStore interface {
+	AddAward(Award) error
+	Awards() AwardList
+	AwardsForTeam(teamID string) AwardList
+	AwardsByCategory(teamID string) map[string]int
+	Scoreboard() map[string]map[string]int
+	Totals() map[string]int
+}
+
+type awardstore struct {
+	m      sync.Mutex
+	path   string
+	awards AwardList
+}
+
+// NewAwardStore loads the award log at path, if it exists, and returns a
+// store ready to append further awards to it.
+func NewAwardStore(path string) (*awardstore, error) {
+	as := &awardstore{path: path}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return as, nil
+		}
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(raw), "\n") {
+		if line == "" {
+			continue
+		}
+
+		a, err := ParseAward(line)
+		if err != nil {
+			return nil, err
+		}
+
+		as.awards = append(as.awards, a)
+	}
+	sort.Sort(as.awards)
+
+	return as, nil
+}
+
+// AddAward appends a to the award log. It is idempotent per (TeamID, Tag): a
+// repeat submission of an already-awarded challenge (client retry,
+// double-click, a daemon bug re-calling CompleteChallenge) is a no-op rather
+// than a second row, since the log itself has no other way to guard against
+// double-scoring a flag.
+func (as *awardstore) AddAward(a Award) error {
+	as.m.Lock()
+	defer as.m.Unlock()
+
+	for _, existing := range as.awards {
+		if existing.TeamID == a.TeamID && existing.Tag == a.Tag {
+			return nil
+		}
+	}
+
+	f, err := os.OpenFile(as.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintln(f, a.String()); err != nil {
+		return err
+	}
+
+	as.awards = append(as.awards, a)
+
+	return nil
+}
+
+func (as *awardstore) Awards() AwardList {
+	as.m.Lock()
+	defer as.m.Unlock()
+
+	cpy := make(AwardList, len(as.awards))
+	copy(cpy, as.awards)
+
+	return cpy
+}
+
+func (as *awardstore) AwardsForTeam(teamID string) AwardList {
+	var awards AwardList
+	for _, a := range as.Awards() {
+		if a.TeamID == teamID {
+			awards = append(awards, a)
+		}
+	}
+
+	return awards
+}
+
+func (as *awardstore) AwardsByCategory(teamID string) map[string]int {
+	byCategory := make(map[string]int)
+	for _, a := range as.AwardsForTeam(teamID) {
+		byCategory[a.Category] += a.Points
+	}
+
+	return byCategory
+}
+
+// Scoreboard returns, for every team with at least one award, the points
+// earned per category.
+func (as *awardstore) Scoreboard() map[string]map[string]int {
+	board := make(map[string]map[string]int)
+	for _, a := range as.Awards() {
+		team, ok := board[a.TeamID]
+		if !ok {
+			team = make(map[string]int)
+			board[a.TeamID] = team
+		}
+		team[a.Category] += a.Points
+	}
+
+	return board
+}
+
+// Totals returns the summed points per team across all categories.
+func (as *awardstore) Totals() map[string]int {
+	totals := make(map[string]int)
+	for teamID, categories := range as.Scoreboard() {
+		for _, points := range categories {
+			totals[teamID] += points
+		}
+	}
+
+	return totals
+}
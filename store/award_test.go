@@ -0,0 +1,94 @@
+// Copyright (c) 2018-2019 Aalborg University
+// Use of this source code is governed by a GPLv3
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAwardStringParseRoundTrip(t *testing.T) {
+	cases := []Award{
+		{When: 1558364461, TeamID: "3ad21", Tag: "web-security-1", Category: "web-security", Points: 50},
+		{When: 1558364462, TeamID: "3ad21", Tag: "web-security-2", Category: "Web Security", Points: 25},
+		{When: 1558364463, TeamID: "3ad21", Tag: "web-security-3", Category: "Reverse\nEngineering", Points: 10},
+	}
+
+	for _, want := range cases {
+		line := want.String()
+
+		got, err := ParseAward(line)
+		if err != nil {
+			t.Fatalf("ParseAward(%q) failed: %s", line, err)
+		}
+
+		if got != want {
+			t.Errorf("ParseAward(%q) = %+v, want %+v", line, got, want)
+		}
+	}
+}
+
+func TestAwardStringIsSingleLine(t *testing.T) {
+	a := Award{When: 1, TeamID: "t", Tag: "tag", Category: "Web Security", Points: 1}
+
+	line := a.String()
+	for _, r := range line {
+		if r == '\n' {
+			t.Fatalf("Award.String() contains a newline, breaking the one-award-per-line log format: %q", line)
+		}
+	}
+}
+
+func TestParseAwardRejectsMalformedLine(t *testing.T) {
+	if _, err := ParseAward("not a valid award line"); err == nil {
+		t.Error("ParseAward accepted a malformed line")
+	}
+}
+
+// TestAddAwardDedupsRepeatSubmission guards against a retried flag
+// submission silently doubling a team's score: a second AddAward for the
+// same (TeamID, Tag) must not add a second row.
+func TestAddAwardDedupsRepeatSubmission(t *testing.T) {
+	dir, err := ioutil.TempDir("", "awardstore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	as, err := NewAwardStore(filepath.Join(dir, "awards.log"))
+	if err != nil {
+		t.Fatalf("NewAwardStore: %s", err)
+	}
+
+	first := Award{When: 1, TeamID: "team-1", Tag: "web-security-1", Category: "web-security", Points: 50}
+	if err := as.AddAward(first); err != nil {
+		t.Fatalf("AddAward: %s", err)
+	}
+
+	retry := first
+	retry.When = 2
+	if err := as.AddAward(retry); err != nil {
+		t.Fatalf("AddAward (retry): %s", err)
+	}
+
+	awards := as.AwardsForTeam("team-1")
+	if len(awards) != 1 {
+		t.Fatalf("AwardsForTeam returned %d awards after a repeat submission, want 1: %+v", len(awards), awards)
+	}
+
+	if totals := as.Totals(); totals["team-1"] != 50 {
+		t.Errorf("Totals()[\"team-1\"] = %d, want 50 (repeat submission must not double-score)", totals["team-1"])
+	}
+
+	// A different tag for the same team must still be recorded.
+	if err := as.AddAward(Award{When: 3, TeamID: "team-1", Tag: "web-security-2", Category: "web-security", Points: 25}); err != nil {
+		t.Fatalf("AddAward (different tag): %s", err)
+	}
+	if totals := as.Totals(); totals["team-1"] != 75 {
+		t.Errorf("Totals()[\"team-1\"] = %d, want 75 after a genuinely new award", totals["team-1"])
+	}
+}
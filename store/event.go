@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"github.com/aau-network-security/haaukins"
 	"github.com/dgrijalva/jwt-go"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -16,22 +17,24 @@ import (
 	"sync"
 	"time"
 
-	"github.com/rs/zerolog/log"
+	"github.com/hashicorp/go-hclog"
 	"gopkg.in/yaml.v2"
 )
 
 const (
 	ID_KEY       = "I"
 	TEAMNAME_KEY = "TN"
+	PID_KEY      = "PID"
 )
 
 var (
-	TeamExistsErr       = errors.New("Team already exists")
-	UnknownTeamErr      = errors.New("Unknown team")
-	UnknownTokenErr     = errors.New("Unknown token")
-	NoFrontendErr       = errors.New("lab requires at least one frontend")
-	InvalidFlagValueErr = errors.New("Incorrect value for flag")
-	UnknownChallengeErr = errors.New("Unknown challenge")
+	TeamExistsErr         = errors.New("Team already exists")
+	UnknownTeamErr        = errors.New("Unknown team")
+	UnknownTokenErr       = errors.New("Unknown token")
+	NoFrontendErr         = errors.New("lab requires at least one frontend")
+	InvalidFlagValueErr   = errors.New("Incorrect value for flag")
+	UnknownChallengeErr   = errors.New("Unknown challenge")
+	UnknownParticipantErr = errors.New("Unknown participant")
 )
 
 type RawEvent struct {
@@ -54,6 +57,8 @@ type EventConfig struct {
 	StartedAt  *time.Time `yaml:"started-at,omitempty"`
 	FinishExpected  *time.Time `yaml:"finish-req,omitempty"`
 	FinishedAt *time.Time `yaml:"finished-at,omitempty"`
+	SigningKey   []byte   `yaml:"signing-key,omitempty"`
+	PreviousKeys [][]byte `yaml:"previous-keys,omitempty"`
 }
 
 type RawEventFile struct {
@@ -90,6 +95,8 @@ type Challenge struct {
 	OwnerID     string     `yaml:"-"`
 	FlagTag     Tag        `yaml:"tag"`
 	FlagValue   string     `yaml:"-"`
+	Category    string     `yaml:"category,omitempty"`
+	Points      int        `yaml:"points,omitempty"`
 	CompletedAt *time.Time `yaml:"completed-at,omitempty"`
 }
 
@@ -103,6 +110,7 @@ type Team struct {
 	CreatedAt        *time.Time        `yaml:"created-at,omitempty"`
 	ChalMap          map[Tag]Challenge `yaml:"-"`
 	AccessedAt       *time.Time        `yaml:"accessed-at,omitempty"`
+	Participants     []Participant     `yaml:"participants,omitempty"`
 }
 
 func WithTeams(teams []*haaukins.Team) func (ts *teamstore){
@@ -117,21 +125,34 @@ type EventConfigStore interface {
 	Read() EventConfig
 	SetCapacity(n int) error
 	Finish(time.Time) error
+	RotateKey() error
+	SetFinishExpected(*time.Time) error
+	AddExercises(...Tag) error
+	AddFrontends(...InstanceConfig) error
 }
 
 type eventconfigstore struct {
-	m     sync.Mutex
-	conf  EventConfig
-	hooks []func(EventConfig) error
+	m      sync.Mutex
+	conf   EventConfig
+	hooks  []func(EventConfig) error
+	logger hclog.Logger
 }
 
 func NewEventConfigStore(conf EventConfig, hooks ...func(EventConfig) error) *eventconfigstore {
 	return &eventconfigstore{
-		conf:  conf,
-		hooks: hooks,
+		conf:   conf,
+		hooks:  hooks,
+		logger: hclog.NewNullLogger(),
 	}
 }
 
+// WithLogger overrides the logger this store derives its sub-logger from and
+// returns the store, so it can be chained onto NewEventConfigStore.
+func (es *eventconfigstore) WithLogger(l hclog.Logger) *eventconfigstore {
+	es.logger = l.Named("store.eventconfig")
+	return es
+}
+
 func (es *eventconfigstore) Read() EventConfig {
 	es.m.Lock()
 	defer es.m.Unlock()
@@ -157,6 +178,53 @@ func (es *eventconfigstore) Finish(t time.Time) error {
 	return es.runHooks()
 }
 
+func (es *eventconfigstore) SetFinishExpected(t *time.Time) error {
+	es.m.Lock()
+	defer es.m.Unlock()
+
+	es.conf.FinishExpected = t
+
+	return es.runHooks()
+}
+
+func (es *eventconfigstore) AddExercises(tags ...Tag) error {
+	es.m.Lock()
+	defer es.m.Unlock()
+
+	es.conf.Lab.Exercises = append(es.conf.Lab.Exercises, tags...)
+
+	return es.runHooks()
+}
+
+func (es *eventconfigstore) AddFrontends(frontends ...InstanceConfig) error {
+	es.m.Lock()
+	defer es.m.Unlock()
+
+	es.conf.Lab.Frontends = append(es.conf.Lab.Frontends, frontends...)
+
+	return es.runHooks()
+}
+
+// RotateKey retires the current signing key to PreviousKeys and generates a
+// fresh one, so tokens minted before the rotation keep verifying via
+// TokenSigner.Verify while new tokens are signed with the new key.
+func (es *eventconfigstore) RotateKey() error {
+	es.m.Lock()
+	defer es.m.Unlock()
+
+	newKey, err := GenerateSigningKey()
+	if err != nil {
+		return err
+	}
+
+	if es.conf.SigningKey != nil {
+		es.conf.PreviousKeys = append(es.conf.PreviousKeys, es.conf.SigningKey)
+	}
+	es.conf.SigningKey = newKey
+
+	return es.runHooks()
+}
+
 func (es *eventconfigstore) runHooks() error {
 	for _, h := range es.hooks {
 		if err := h(es.conf); err != nil {
@@ -169,6 +237,7 @@ func (es *eventconfigstore) runHooks() error {
 
 type EventFileHub interface {
 	CreateEventFile(EventConfig) (EventFile, error)
+	Restore(path string) (EventFile, error)
 }
 
 type eventfilehub struct {
@@ -179,12 +248,28 @@ type eventfilehub struct {
 type Archiver interface {
 	ArchiveDir() string
 	Archive() error
+	Export(w io.Writer) error
 }
 
 type EventFile interface {
 	TeamStore
 	EventConfigStore
+	AwardStore
+	ParticipantStore
 	Archiver
+	Signer() TokenSigner
+	Reload() error
+
+	// Cleanup removes the temporary directory a restored (read-only)
+	// EventFile was extracted into by EventFileHub.Restore. It is a no-op
+	// for a live event, so every EventFile can be Cleanup'd unconditionally
+	// once the caller is done with it.
+	Cleanup() error
+
+	// Close stops the background fsnotify watcher started by WithWatch, if
+	// any. It is a no-op when no watcher is running, so every EventFile can
+	// be Close'd unconditionally once the caller is done with it.
+	Close() error
 }
 
 type eventfile struct {
@@ -192,25 +277,138 @@ type eventfile struct {
 	file     RawEventFile
 	dir      string
 	filename string
+	readOnly bool
+	tempDir  bool
+
+	participants map[string][]Participant
+	signer       TokenSigner
+	logger       hclog.Logger
+	watch        bool
+
+	// archived is set once Archive has finished writing the archive
+	// directory and mothball tarball, so Export can refuse to stream a
+	// still-being-written archive without having to hold ef.m for the
+	// duration of the export itself.
+	archived bool
+
+	// archiveDir overrides ArchiveDir() when set. Restore extracts a
+	// tarball's contents directly into ef.dir rather than into the
+	// filename-derived subdirectory a live event uses, so a restored
+	// EventFile points ArchiveDir (and therefore Export) at ef.dir itself.
+	archiveDir string
+
+	// configStore is the concrete type behind EventConfigStore. Reload keeps
+	// it around so it can hold configStore.m for its whole decide-and-apply
+	// sequence, serializing against the Set*/Add*/RotateKey methods (which
+	// all take that same lock before firing the ef.saveEventConfig hook)
+	// without itself taking ef.m and inverting that lock order.
+	configStore *eventconfigstore
+
+	// watchClose stops the fsnotify watcher goroutine started by
+	// startWatcher when WithWatch was used, and is nil otherwise. Set and
+	// cleared under ef.m; see closeWatcherLocked and Close.
+	watchClose func()
 
 	TeamStore
 	EventConfigStore
+	AwardStore
+}
+
+// Signer returns the TokenSigner used to mint and verify this event's team
+// tokens.
+func (ef *eventfile) Signer() TokenSigner {
+	return ef.signer
+}
+
+// Cleanup removes the temporary directory a restored (read-only) EventFile
+// was extracted into. It is a no-op for a live event. Callers of
+// EventFileHub.Restore must call this once they are done with the event, or
+// the extracted copy leaks on disk.
+func (ef *eventfile) Cleanup() error {
+	ef.m.Lock()
+	defer ef.m.Unlock()
+
+	if !ef.tempDir {
+		return nil
+	}
+
+	return os.RemoveAll(ef.dir)
+}
+
+// Close stops the background fsnotify watcher started by WithWatch, if one
+// is running. It is idempotent and a no-op when no watcher was started.
+// Callers that passed WithWatch to NewEventFile must call this once they are
+// done with the event, or the watcher goroutine and inotify descriptor leak
+// for the rest of the process's life.
+func (ef *eventfile) Close() error {
+	ef.m.Lock()
+	defer ef.m.Unlock()
+
+	ef.closeWatcherLocked()
+
+	return nil
 }
 
-func NewEventFile(dir string, filename string, file RawEventFile) *eventfile {
+// EventFileOpt configures an eventfile at construction time.
+type EventFileOpt func(*eventfile)
+
+// WithLogger overrides the logger an eventfile derives its sub-loggers from;
+// by default it logs nowhere.
+func WithLogger(l hclog.Logger) EventFileOpt {
+	return func(ef *eventfile) { ef.logger = l }
+}
+
+// WithWatch starts an fsnotify watcher on the event's yaml file that calls
+// Reload whenever it changes on disk.
+func WithWatch() EventFileOpt {
+	return func(ef *eventfile) { ef.watch = true }
+}
+
+func NewEventFile(dir string, filename string, file RawEventFile, opts ...EventFileOpt) (*eventfile, error) {
 	ef := &eventfile{
 		dir:      dir,
 		filename: filename,
 		file:     file,
+		logger:   hclog.NewNullLogger(),
+	}
+	for _, opt := range opts {
+		opt(ef)
+	}
+	ef.logger = ef.logger.Named("store.eventfile").With("event", string(file.Tag))
+
+	ef.participants = make(map[string][]Participant)
+	for _, team := range file.Teams {
+		if len(team.Participants) > 0 {
+			ef.participants[team.Id] = team.Participants
+		}
+	}
+
+	if file.EventConfig.SigningKey == nil {
+		key, err := GenerateSigningKey()
+		if err != nil {
+			return nil, fmt.Errorf("error generating signing key: %s", err)
+		}
+		file.EventConfig.SigningKey = key
+		ef.file.SigningKey = key
+
+		// Persist immediately: a key that only lives in memory until some
+		// unrelated mutation happens to trigger a save is lost on an early
+		// restart, silently invalidating every token issued in the meantime.
+		if err := ef.save(); err != nil {
+			return nil, fmt.Errorf("error persisting generated signing key: %s", err)
+		}
 	}
+	ef.configStore = NewEventConfigStore(file.EventConfig, ef.saveEventConfig).WithLogger(ef.logger)
+	ef.EventConfigStore = ef.configStore
+	ef.signer = NewTokenSigner(ef.EventConfigStore)
 
 	var teams []*haaukins.Team
-	ts := NewTeamStore(WithTeams(teams), WithPostTeamHook(ef.saveTeams))
+	ts := NewTeamStore(WithTeams(teams), WithPostTeamHook(ef.saveTeams), WithPostChallengeHook(ef.recordAward))
 	for _, team  := range file.Teams {
 		tn:= haaukins.NewTeam(team.Email, team.Name,"",team.Id,team.HashedPassword)
-		teamtoken, err := GetTokenForTeam([]byte("testing purposes"), tn )
+		teamtoken, err := ef.signer.Sign(tn)
 		if err != nil {
-			log.Debug().Msgf("Error in getting token for team %s", tn.Name())
+			ef.logger.Debug("error minting token for team", "team", tn.Name(), "error", err)
 		}
 		ts.tokens[teamtoken]=tn.ID()
 		ts.emails[tn.Email()]=tn.ID()
@@ -218,16 +416,58 @@ func NewEventFile(dir string, filename string, file RawEventFile) *eventfile {
 		teams= append(teams, tn)
 	}
 	ef.TeamStore = ts
-	ef.EventConfigStore = NewEventConfigStore(file.EventConfig, ef.saveEventConfig)
 
-	return ef
+	awardStore, err := NewAwardStore(filepath.Join(dir, "awards.log"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading award store: %s", err)
+	}
+	ef.AwardStore = awardStore
+
+	if ef.watch {
+		if err := ef.startWatcher(); err != nil {
+			ef.logger.Warn("failed to start event file watcher", "error", err)
+		}
+	}
+
+	return ef, nil
 }
 
-func GetTokenForTeam(key []byte, t *haaukins.Team) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// recordAward is the post-challenge hook passed to the teamstore: whenever a
+// team's ChalMap gains a completed challenge, the corresponding score is
+// appended to awards.log instead of being folded into the team's yaml blob.
+func (ef *eventfile) recordAward(teamID string, ch Challenge) error {
+	if ch.CompletedAt == nil {
+		return nil
+	}
+
+	category := ch.Category
+	if category == "" {
+		category = string(ch.FlagTag)
+	}
+
+	return ef.AddAward(Award{
+		When:     ch.CompletedAt.Unix(),
+		TeamID:   teamID,
+		Tag:      string(ch.FlagTag),
+		Category: category,
+		Points:   ch.Points,
+	})
+}
+
+// GetTokenForTeam mints a JWT for the given team. When participantID is
+// non-empty, it is embedded under PID_KEY so that individual activity (flag
+// captures, logins) can be attributed to the student behind a shared team
+// credential rather than just the team as a whole.
+func GetTokenForTeam(key []byte, t *haaukins.Team, participantID string) (string, error) {
+	claims := jwt.MapClaims{
 		ID_KEY:       t.ID(),
 		TEAMNAME_KEY: t.Name(),
-	})
+	}
+	if participantID != "" {
+		claims[PID_KEY] = participantID
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenStr, err := token.SignedString(key)
 	if err != nil {
 		return "", err
@@ -235,16 +475,48 @@ func GetTokenForTeam(key []byte, t *haaukins.Team) (string, error) {
 	return tokenStr, nil
 }
 
+// ReadOnlyErr is returned by mutating operations on an EventFile that was
+// rehydrated from an archive via EventFileHub.Restore.
+var ReadOnlyErr = errors.New("event is archived and read-only")
+
+// save rewrites the event yaml via a temp-file-plus-rename so a concurrent
+// Reload (triggered by the fsnotify watcher from WithWatch) never observes a
+// half-written file.
 func (ef *eventfile) save() error {
+	if ef.readOnly {
+		return ReadOnlyErr
+	}
+
 	bytes, err := yaml.Marshal(ef.file)
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(ef.path(), bytes, 0644)
+	tmp, err := ioutil.TempFile(ef.dir, "."+ef.filename+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(bytes); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, ef.path())
 }
 
 func (ef *eventfile) delete() error {
+	if ef.readOnly {
+		return ReadOnlyErr
+	}
+
 	return os.Remove(ef.path())
 }
 
@@ -264,7 +536,8 @@ func (ef *eventfile) saveTeams(teams []*haaukins.Team) error {
 			Name:           t.Name(),
 			HashedPassword: t.GetHashedPassword(),
 			//SolvedChallenges: solvedChallenges,
-			AccessedAt: &now,
+			AccessedAt:   &now,
+			Participants: ef.participants[t.ID()],
 		}
 		storeTeam = append(storeTeam, team)
 	}
@@ -286,11 +559,21 @@ func (ef *eventfile) path() string {
 }
 
 func (ef *eventfile) ArchiveDir() string {
+	if ef.archiveDir != "" {
+		return ef.archiveDir
+	}
+
 	parts := strings.Split(ef.filename, ".")
 	relativeDir := strings.Join(parts[:len(parts)-1], ".")
 	return filepath.Join(ef.dir, relativeDir)
 }
 
+// mothballPath returns the path of the tarball produced by Archive, e.g.
+// <dir>/<tag>-<date>.tgz.
+func (ef *eventfile) mothballPath() string {
+	return filepath.Join(ef.dir, fmt.Sprintf("%s-%s.tgz", ef.file.Tag, time.Now().Format("02-01-06")))
+}
+
 func (ef *eventfile) Archive() error {
 	ef.m.Lock()
 	defer ef.m.Unlock()
@@ -301,26 +584,84 @@ func (ef *eventfile) Archive() error {
 		}
 	}
 
-	//cpy := eventfile{
-	//	file:     ef.file,
-	//	dir:      ef.ArchiveDir(),
-	//	filename: "config.yml",
-	//}
-	//
-	//cpy.file.Teams = []*haaukins.Team{}
-	//for _, t := range ef.GetTeams() {
-	//
-	//	cpy.file.Teams = append(cpy.file.Teams, t)
-	//}
-	//cpy.save()
+	finishedAt := time.Now()
+	conf := ef.file.EventConfig
+	conf.FinishedAt = &finishedAt
+
+	confBytes, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(ef.ArchiveDir(), "config.yml"), confBytes, 0644); err != nil {
+		return err
+	}
+
+	teams := make([]Team, len(ef.file.Teams))
+	copy(teams, ef.file.Teams)
+	awards := ef.AwardStore.Awards()
+	for i, t := range teams {
+		teams[i].SolvedChallenges = solvedChallengesForTeam(t.Id, awards)
+	}
+
+	teamsBytes, err := yaml.Marshal(teams)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(ef.ArchiveDir(), "teams.yml"), teamsBytes, 0644); err != nil {
+		return err
+	}
+
+	if ef.AwardStore != nil && len(ef.AwardStore.Awards()) > 0 {
+		if err := writeAwardsLog(ef.AwardStore.Awards(), filepath.Join(ef.ArchiveDir(), "awards.log")); err != nil {
+			return err
+		}
+	}
+
+	mothball := ef.mothballPath()
+	if err := tarGzDir(ef.ArchiveDir(), mothball); err != nil {
+		return err
+	}
+
+	if err := writeSHA256Manifest(mothball); err != nil {
+		return err
+	}
 
 	if err := ef.delete(); err != nil {
-		log.Warn().Msgf("Failed to delete old event file: %s", err)
+		ef.logger.Warn("failed to delete old event file", "error", err)
 	}
 
+	ef.archived = true
+
+	// The yaml this event's watcher (if any) was watching no longer exists;
+	// stop it rather than leaving it running against a deleted file.
+	ef.closeWatcherLocked()
+
 	return nil
 }
 
+// NotArchivedErr is returned by Export when called before Archive has
+// finished writing the archive directory and mothball tarball.
+var NotArchivedErr = errors.New("event has not finished archiving yet")
+
+// Export streams the archived event as a tar.gz, so an admin API can offer a
+// completed event for download without shelling out to the filesystem. It
+// only takes ef.m long enough to confirm Archive has finished and to read
+// the (by then immutable) archive directory path; the unbounded write to w
+// runs without the lock held, so a slow client can't block team saves,
+// challenge completions or Reload for the duration of the download.
+func (ef *eventfile) Export(w io.Writer) error {
+	ef.m.Lock()
+	archived := ef.archived
+	dir := ef.ArchiveDir()
+	ef.m.Unlock()
+
+	if !archived {
+		return NotArchivedErr
+	}
+
+	return tarGzWriter(dir, w)
+}
+
 func getFileNameForEvent(path string, tag Tag) (string, error) {
 	now := time.Now().Format("02-01-06")
 	dirname := fmt.Sprintf("%s-%s", tag, now)
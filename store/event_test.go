@@ -0,0 +1,51 @@
+// Copyright (c) 2018-2019 Aalborg University
+// Use of this source code is governed by a GPLv3
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TestNewEventFilePersistsGeneratedSigningKey guards against a generated key
+// only living in memory: a process restart right after NewEventFile must see
+// the same key it just generated, not a fresh one.
+func TestNewEventFilePersistsGeneratedSigningKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventfile-signing-key-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ef, err := NewEventFile(dir, "test-event.yml", RawEventFile{
+		EventConfig: EventConfig{Name: "test event", Tag: "test-event"},
+	})
+	if err != nil {
+		t.Fatalf("NewEventFile: %s", err)
+	}
+
+	key := ef.EventConfigStore.Read().SigningKey
+	if len(key) == 0 {
+		t.Fatal("NewEventFile did not generate a signing key")
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "test-event.yml"))
+	if err != nil {
+		t.Fatalf("reading persisted event yaml: %s", err)
+	}
+
+	var onDisk RawEventFile
+	if err := yaml.Unmarshal(raw, &onDisk); err != nil {
+		t.Fatalf("unmarshalling persisted event yaml: %s", err)
+	}
+
+	if string(onDisk.SigningKey) != string(key) {
+		t.Errorf("persisted signing key = %x, want %x (the key NewEventFile generated in memory)", onDisk.SigningKey, key)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2018-2019 Aalborg University
+// Use of this source code is governed by a GPLv3
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Participant is a single student behind a shared team credential. Keeping
+// participants separate from Team lets the instructor dashboard attribute
+// flag captures and login activity to a person instead of a whole team.
+type Participant struct {
+	ID          string     `yaml:"id"`
+	DisplayName string     `yaml:"display-name"`
+	CreatedAt   *time.Time `yaml:"created-at,omitempty"`
+	LastSeenAt  *time.Time `yaml:"last-seen-at,omitempty"`
+}
+
+// ParticipantStore manages the roster of participants within a team.
+type ParticipantStore interface {
+	RegisterParticipant(teamID, displayName string) (pid string, err error)
+	TouchParticipant(pid string) error
+}
+
+func (ef *eventfile) RegisterParticipant(teamID, displayName string) (string, error) {
+	if _, err := ef.TeamStore.GetTeamByID(teamID); err != nil {
+		return "", UnknownTeamErr
+	}
+
+	ef.m.Lock()
+	defer ef.m.Unlock()
+
+	now := time.Now()
+	p := Participant{
+		ID:          uuid.New().String(),
+		DisplayName: displayName,
+		CreatedAt:   &now,
+		LastSeenAt:  &now,
+	}
+
+	ef.participants[teamID] = append(ef.participants[teamID], p)
+
+	return p.ID, ef.persistParticipants()
+}
+
+func (ef *eventfile) TouchParticipant(pid string) error {
+	ef.m.Lock()
+	defer ef.m.Unlock()
+
+	now := time.Now()
+	for teamID, participants := range ef.participants {
+		for i, p := range participants {
+			if p.ID != pid {
+				continue
+			}
+
+			participants[i].LastSeenAt = &now
+			ef.participants[teamID] = participants
+
+			return ef.persistParticipants()
+		}
+	}
+
+	return UnknownParticipantErr
+}
+
+// persistParticipants folds the in-memory participant rosters into the
+// already-saved team list and rewrites the yaml. Callers must hold ef.m.
+func (ef *eventfile) persistParticipants() error {
+	for i, t := range ef.file.Teams {
+		ef.file.Teams[i].Participants = ef.participants[t.Id]
+	}
+
+	return ef.save()
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2018-2019 Aalborg University
+// Use of this source code is governed by a GPLv3
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v2"
+)
+
+// ReloadConflictErr is returned by Reload when the on-disk yaml contains a
+// destructive edit that cannot be safely applied to a running event.
+type ReloadConflictErr struct {
+	Reason string
+}
+
+func (e *ReloadConflictErr) Error() string {
+	return fmt.Sprintf("cannot reload event: %s", e.Reason)
+}
+
+// Reload re-reads the event yaml from disk and applies non-destructive
+// changes - capacity, finish-req, additional exercises/frontends - as a
+// single atomic update. Destructive edits, such as removing an exercise that
+// already has solve records or changing Tag, are rejected with a
+// ReloadConflictErr so a bad edit on disk can never corrupt a running event.
+//
+// The decide-and-apply sequence runs under ef.configStore.m held for its
+// entire duration, not just the final write: every EventConfigStore mutator
+// (SetCapacity, SetFinishExpected, AddExercises, AddFrontends, RotateKey)
+// takes that same lock first before firing the ef.saveEventConfig hook, so
+// holding it here blocks any of them from interleaving mid-reload. It
+// deliberately does not also hold ef.m across the sequence: that hook locks
+// ef.m itself, and every existing caller takes configStore.m before ef.m, so
+// reload must follow the same order rather than inverting it (ef.m then
+// configStore.m), which would deadlock against a concurrent SetCapacity/etc.
+// call. The initial file read needs no lock: save() always rewrites the
+// event yaml via temp-file-plus-rename, so a concurrent read can only ever
+// observe the old or the new content in full, never a partial write.
+func (ef *eventfile) Reload() error {
+	raw, err := ioutil.ReadFile(ef.path())
+	if err != nil {
+		return err
+	}
+
+	var onDisk RawEventFile
+	if err := yaml.Unmarshal(raw, &onDisk); err != nil {
+		return err
+	}
+
+	ef.configStore.m.Lock()
+	defer ef.configStore.m.Unlock()
+
+	current := ef.configStore.conf
+
+	if onDisk.Tag != current.Tag {
+		return &ReloadConflictErr{Reason: "tag cannot be changed"}
+	}
+
+	for _, tag := range removedTags(current.Lab.Exercises, onDisk.Lab.Exercises) {
+		if ef.hasSolvesFor(tag) {
+			return &ReloadConflictErr{Reason: fmt.Sprintf("exercise %q has solve records and cannot be removed", tag)}
+		}
+	}
+
+	next := current
+	next.Capacity = onDisk.Capacity
+	next.FinishExpected = onDisk.FinishExpected
+
+	changed := onDisk.Capacity != current.Capacity || !equalTimePtr(onDisk.FinishExpected, current.FinishExpected)
+
+	if added := addedTags(current.Lab.Exercises, onDisk.Lab.Exercises); len(added) > 0 {
+		next.Lab.Exercises = append(append([]Tag{}, current.Lab.Exercises...), added...)
+		changed = true
+	}
+
+	if added := addedFrontends(current.Lab.Frontends, onDisk.Lab.Frontends); len(added) > 0 {
+		next.Lab.Frontends = append(append([]InstanceConfig{}, current.Lab.Frontends...), added...)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	ef.configStore.conf = next
+
+	return ef.configStore.runHooks()
+}
+
+// hasSolvesFor reports whether any award has been recorded for the given
+// exercise tag, i.e. whether removing it would discard scoring data.
+// Category is user-overridable display text and so cannot be trusted to
+// identify the exercise; Tag is the stable key.
+func (ef *eventfile) hasSolvesFor(tag Tag) bool {
+	for _, a := range ef.AwardStore.Awards() {
+		if a.Tag == string(tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startWatcher watches the event's yaml file for changes and calls Reload
+// whenever it is written to. It watches the parent directory rather than the
+// file itself: editors and "mv" commonly replace a file via rename, which
+// drops the inode fsnotify was watching and would otherwise silently end the
+// watch after the first edit.
+//
+// The watcher goroutine only exits once stopWatcher closes done, so it never
+// terminates on its own; callers of WithWatch must eventually call
+// eventfile.Close (directly, or via Archive, which stops the watch once the
+// yaml it watches has been deleted), or the goroutine and inotify descriptor
+// leak for the rest of the process's life.
+func (ef *eventfile) startWatcher() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := w.Add(ef.dir); err != nil {
+		w.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	ef.watchClose = func() {
+		close(done)
+		w.Close()
+	}
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(event.Name) != ef.filename {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := ef.Reload(); err != nil {
+					ef.logger.Warn("failed to reload event file", "error", err)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				ef.logger.Warn("event file watcher error", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// closeWatcherLocked stops the background fsnotify watcher started by
+// startWatcher, if any, and is safe to call even when none was started.
+// Callers must already hold ef.m.
+func (ef *eventfile) closeWatcherLocked() {
+	if ef.watchClose == nil {
+		return
+	}
+
+	stop := ef.watchClose
+	ef.watchClose = nil
+	stop()
+}
+
+func removedTags(old, new []Tag) []Tag {
+	newSet := make(map[Tag]bool, len(new))
+	for _, t := range new {
+		newSet[t] = true
+	}
+
+	var removed []Tag
+	for _, t := range old {
+		if !newSet[t] {
+			removed = append(removed, t)
+		}
+	}
+
+	return removed
+}
+
+func addedTags(old, new []Tag) []Tag {
+	oldSet := make(map[Tag]bool, len(old))
+	for _, t := range old {
+		oldSet[t] = true
+	}
+
+	var added []Tag
+	for _, t := range new {
+		if !oldSet[t] {
+			added = append(added, t)
+		}
+	}
+
+	return added
+}
+
+func addedFrontends(old, new []InstanceConfig) []InstanceConfig {
+	var added []InstanceConfig
+	for _, n := range new {
+		found := false
+		for _, o := range old {
+			if reflect.DeepEqual(o, n) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			added = append(added, n)
+		}
+	}
+
+	return added
+}
+
+func equalTimePtr(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2018-2019 Aalborg University
+// Use of this source code is governed by a GPLv3
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TestWatcherReloadsOnChangeAndStopsOnClose exercises the WithWatch +
+// Reload + Close lifecycle end-to-end: an on-disk edit is picked up while
+// the watcher runs, and Close (idempotent) stops it from picking up any
+// further edit.
+func TestWatcherReloadsOnChangeAndStopsOnClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventfile-watch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const filename = "test-event.yml"
+
+	ef, err := NewEventFile(dir, filename, RawEventFile{
+		EventConfig: EventConfig{Name: "test event", Tag: "test-event", Capacity: 1},
+	}, WithWatch())
+	if err != nil {
+		t.Fatalf("NewEventFile: %s", err)
+	}
+	defer ef.Close()
+
+	if ef.watchClose == nil {
+		t.Fatal("WithWatch did not start a watcher")
+	}
+
+	writeRawEventFile(t, dir, filename, RawEventFile{
+		EventConfig: EventConfig{Name: "test event", Tag: "test-event", Capacity: 5},
+	})
+
+	if !pollUntil(func() bool { return ef.EventConfigStore.Read().Capacity == 5 }) {
+		t.Fatal("watcher did not pick up the on-disk capacity change")
+	}
+
+	if err := ef.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if ef.watchClose != nil {
+		t.Error("Close did not clear watchClose")
+	}
+
+	if err := ef.Close(); err != nil {
+		t.Fatalf("second Close must be a no-op, got: %s", err)
+	}
+
+	writeRawEventFile(t, dir, filename, RawEventFile{
+		EventConfig: EventConfig{Name: "test event", Tag: "test-event", Capacity: 9},
+	})
+	time.Sleep(200 * time.Millisecond)
+
+	if got := ef.EventConfigStore.Read().Capacity; got == 9 {
+		t.Error("watcher kept reloading changes after Close")
+	}
+}
+
+// TestArchiveStopsWatcher checks that Archive tears down a running watcher:
+// the yaml it watched is deleted as part of archiving, so the watch must not
+// keep running against it.
+func TestArchiveStopsWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventfile-watch-archive-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ef, err := NewEventFile(dir, "test-event.yml", RawEventFile{
+		EventConfig: EventConfig{Name: "test event", Tag: "test-event"},
+	}, WithWatch())
+	if err != nil {
+		t.Fatalf("NewEventFile: %s", err)
+	}
+	defer ef.Close()
+
+	if ef.watchClose == nil {
+		t.Fatal("WithWatch did not start a watcher")
+	}
+
+	if err := ef.Archive(); err != nil {
+		t.Fatalf("Archive: %s", err)
+	}
+
+	if ef.watchClose != nil {
+		t.Error("Archive left the watcher running against a deleted event file")
+	}
+}
+
+func writeRawEventFile(t *testing.T, dir, filename string, raw RawEventFile) {
+	t.Helper()
+
+	bytes, err := yaml.Marshal(raw)
+	if err != nil {
+		t.Fatalf("marshalling test event yaml: %s", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, filename), bytes, 0644); err != nil {
+		t.Fatalf("writing test event yaml: %s", err)
+	}
+}
+
+func pollUntil(cond func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return cond()
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2018-2019 Aalborg University
+// Use of this source code is governed by a GPLv3
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"sync"
+
+	"github.com/aau-network-security/haaukins"
+)
+
+// TeamStore manages the authoritative set of teams for an event: lookups by
+// id and token, persistence via post-team hooks, and challenge completion via
+// post-challenge hooks.
+type TeamStore interface {
+	SaveTeam(t *haaukins.Team) error
+	GetTeams() []*haaukins.Team
+	GetTeamByID(id string) (*haaukins.Team, error)
+	GetTeamByToken(token string) (*haaukins.Team, error)
+	CompleteChallenge(teamID string, ch Challenge) error
+}
+
+type teamstore struct {
+	m      sync.Mutex
+	teams  map[string]*haaukins.Team
+	tokens map[string]string
+	emails map[string]string
+
+	postTeamHooks      []func([]*haaukins.Team) error
+	postChallengeHooks []func(teamID string, ch Challenge) error
+}
+
+// TeamStoreOpt configures a teamstore at construction time.
+type TeamStoreOpt func(*teamstore)
+
+// WithPostTeamHook registers a hook that fires with the full team list
+// whenever a team is saved, so the caller can persist it (e.g. eventfile's
+// yaml write).
+func WithPostTeamHook(hook func([]*haaukins.Team) error) TeamStoreOpt {
+	return func(ts *teamstore) {
+		ts.postTeamHooks = append(ts.postTeamHooks, hook)
+	}
+}
+
+// WithPostChallengeHook registers a hook that fires whenever a challenge is
+// marked completed via CompleteChallenge, so scoring (or any other state
+// derived from solves) can be recorded without the team blob itself having
+// to carry it.
+func WithPostChallengeHook(hook func(teamID string, ch Challenge) error) TeamStoreOpt {
+	return func(ts *teamstore) {
+		ts.postChallengeHooks = append(ts.postChallengeHooks, hook)
+	}
+}
+
+func NewTeamStore(opts ...TeamStoreOpt) *teamstore {
+	ts := &teamstore{
+		teams:  make(map[string]*haaukins.Team),
+		tokens: make(map[string]string),
+		emails: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(ts)
+	}
+
+	return ts
+}
+
+func (ts *teamstore) SaveTeam(t *haaukins.Team) error {
+	ts.m.Lock()
+	ts.teams[t.ID()] = t
+	ts.emails[t.Email()] = t.ID()
+	ts.m.Unlock()
+
+	return ts.runPostTeamHooks()
+}
+
+func (ts *teamstore) GetTeams() []*haaukins.Team {
+	ts.m.Lock()
+	defer ts.m.Unlock()
+
+	teams := make([]*haaukins.Team, 0, len(ts.teams))
+	for _, t := range ts.teams {
+		teams = append(teams, t)
+	}
+
+	return teams
+}
+
+func (ts *teamstore) GetTeamByID(id string) (*haaukins.Team, error) {
+	ts.m.Lock()
+	defer ts.m.Unlock()
+
+	t, ok := ts.teams[id]
+	if !ok {
+		return nil, UnknownTeamErr
+	}
+
+	return t, nil
+}
+
+func (ts *teamstore) GetTeamByToken(token string) (*haaukins.Team, error) {
+	ts.m.Lock()
+	defer ts.m.Unlock()
+
+	id, ok := ts.tokens[token]
+	if !ok {
+		return nil, UnknownTokenErr
+	}
+
+	t, ok := ts.teams[id]
+	if !ok {
+		return nil, UnknownTeamErr
+	}
+
+	return t, nil
+}
+
+// CompleteChallenge marks ch as solved for teamID and fires every registered
+// post-challenge hook, e.g. eventfile.recordAward appending an Award to the
+// event's scoring log.
+func (ts *teamstore) CompleteChallenge(teamID string, ch Challenge) error {
+	ts.m.Lock()
+	_, ok := ts.teams[teamID]
+	ts.m.Unlock()
+	if !ok {
+		return UnknownTeamErr
+	}
+
+	for _, hook := range ts.postChallengeHooks {
+		if err := hook(teamID, ch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ts *teamstore) runPostTeamHooks() error {
+	teams := ts.GetTeams()
+
+	for _, hook := range ts.postTeamHooks {
+		if err := hook(teams); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
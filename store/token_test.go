@@ -0,0 +1,69 @@
+// Copyright (c) 2018-2019 Aalborg University
+// Use of this source code is governed by a GPLv3
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/aau-network-security/haaukins"
+)
+
+func TestTokenSignerVerifyAcrossRotation(t *testing.T) {
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %s", err)
+	}
+
+	cs := NewEventConfigStore(EventConfig{SigningKey: key})
+	signer := NewTokenSigner(cs)
+	team := haaukins.NewTeam("team@example.com", "team", "", "team-id", "")
+
+	oldToken, err := signer.Sign(team)
+	if err != nil {
+		t.Fatalf("Sign: %s", err)
+	}
+
+	if err := cs.RotateKey(); err != nil {
+		t.Fatalf("RotateKey: %s", err)
+	}
+
+	newToken, err := signer.Sign(team)
+	if err != nil {
+		t.Fatalf("Sign after rotation: %s", err)
+	}
+
+	if id, err := signer.Verify(oldToken); err != nil || id != team.ID() {
+		t.Errorf("Verify(oldToken) = (%q, %v), want (%q, nil)", id, err, team.ID())
+	}
+
+	if id, err := signer.Verify(newToken); err != nil || id != team.ID() {
+		t.Errorf("Verify(newToken) = (%q, %v), want (%q, nil)", id, err, team.ID())
+	}
+}
+
+func TestTokenSignerVerifyRejectsUnrelatedKey(t *testing.T) {
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %s", err)
+	}
+	otherKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %s", err)
+	}
+
+	signer := NewTokenSigner(NewEventConfigStore(EventConfig{SigningKey: key}))
+	otherSigner := NewTokenSigner(NewEventConfigStore(EventConfig{SigningKey: otherKey}))
+
+	team := haaukins.NewTeam("team@example.com", "team", "", "team-id", "")
+
+	token, err := otherSigner.Sign(team)
+	if err != nil {
+		t.Fatalf("Sign: %s", err)
+	}
+
+	if _, err := signer.Verify(token); err == nil {
+		t.Error("Verify accepted a token signed with an unrelated key")
+	}
+}